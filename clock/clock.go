@@ -1,24 +1,239 @@
+// Package clock abstracts time-dependent operations (Now, Sleep, timers,
+// tickers) behind the Clock interface so code that schedules work can be
+// driven by a FakeClock in tests instead of waiting on real wall-clock time.
+// It also provides Snapshot, a small, comparable, JSON-serializable capture
+// of a point in time.
 package clock
 
 import (
-	"fmt"
+	"encoding/json"
+	"sync"
 	"time"
 )
 
-type Clock struct {
+// Clock is the subset of the time package that scheduling code needs. Code
+// that takes a Clock instead of calling time.* directly can be tested with a
+// FakeClock instead of real sleeps.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer mirrors the part of *time.Timer that callers need.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker mirrors the part of *time.Ticker that callers need.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// NewRealClock returns a Clock backed by the real time package.
+func NewRealClock() Clock { return realClock{} }
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                   { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration  { return time.Since(t) }
+func (realClock) Sleep(d time.Duration)            { time.Sleep(d) }
+func (realClock) NewTimer(d time.Duration) Timer   { return &realTimer{timer: time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker { return &realTicker{ticker: time.NewTicker(d)} }
+
+type realTimer struct{ timer *time.Timer }
+
+func (t *realTimer) C() <-chan time.Time        { return t.timer.C }
+func (t *realTimer) Stop() bool                 { return t.timer.Stop() }
+func (t *realTimer) Reset(d time.Duration) bool { return t.timer.Reset(d) }
+
+type realTicker struct{ ticker *time.Ticker }
+
+func (t *realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t *realTicker) Stop()               { t.ticker.Stop() }
+
+// FakeClock is a Clock whose notion of "now" only moves when Advance is
+// called, so timers and tickers registered against it fire deterministically
+// instead of after a real delay. The zero value is not usable; construct one
+// with NewFakeClock.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	events []*fakeEvent
+}
+
+// NewFakeClock returns a FakeClock whose Now() starts at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until Advance has moved the clock forward by at least d.
+func (f *FakeClock) Sleep(d time.Duration) {
+	<-f.NewTimer(d).C()
+}
+
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &fakeEvent{deadline: f.now.Add(d), ch: make(chan time.Time, 1)}
+	f.events = append(f.events, e)
+	return &fakeTimer{clock: f, event: e}
+}
+
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &fakeEvent{deadline: f.now.Add(d), interval: d, repeating: true, ch: make(chan time.Time, 1)}
+	f.events = append(f.events, e)
+	return &fakeTicker{clock: f, event: e}
+}
+
+// Advance moves the fake clock forward by d, firing every timer/ticker whose
+// deadline falls at or before the new time. A repeating ticker fires once per
+// interval elapsed and is rescheduled for the next one; like a real
+// time.Ticker, a tick is dropped (not buffered) if nothing has received the
+// previous one yet.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	for _, e := range f.events {
+		if e.stopped {
+			continue
+		}
+		for !e.deadline.After(f.now) {
+			select {
+			case e.ch <- e.deadline:
+			default:
+			}
+			if !e.repeating {
+				e.stopped = true
+				break
+			}
+			e.deadline = e.deadline.Add(e.interval)
+		}
+	}
+}
+
+type fakeEvent struct {
+	deadline  time.Time
+	interval  time.Duration
+	repeating bool
+	stopped   bool
+	ch        chan time.Time
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	event *fakeEvent
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.event.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.event.stopped
+	t.event.stopped = true
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.event.stopped
+	t.event.stopped = false
+	t.event.deadline = t.clock.now.Add(d)
+	return active
+}
+
+type fakeTicker struct {
+	clock *FakeClock
+	event *fakeEvent
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.event.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.event.stopped = true
+}
+
+// Snapshot is an immutable capture of a point in time, previously named
+// Clock. Unlike Clock (the interface above), it carries no behavior; it
+// exists to be compared, formatted, and JSON-marshalled.
+type Snapshot struct {
 	Hour   int
 	Minute int
 	Second int
 	Time   time.Time
 }
 
-func NewClock(t time.Time) *Clock {
+// NewSnapshot captures t's hour/minute/second alongside t itself. The
+// monotonic reading is stripped via Truncate(0) because a Snapshot is meant
+// to be compared and JSON-marshalled, where the monotonic reading is
+// meaningless and would otherwise make two Snapshots built from the "same"
+// wall-clock time compare unequal.
+func NewSnapshot(t time.Time) *Snapshot {
 	h, m, s := t.Hour(), t.Minute(), t.Second()
-	fmt.Printf("new clock; %s\n", t)
-	return &Clock{
+	return &Snapshot{
 		Hour:   h,
 		Minute: m,
 		Second: s,
 		Time:   t.Truncate(0),
 	}
 }
+
+// In returns a Snapshot of the same instant viewed in loc, with Hour/Minute/
+// Second re-derived so they stay consistent with the converted Time.
+func (s *Snapshot) In(loc *time.Location) *Snapshot {
+	return NewSnapshot(s.Time.In(loc))
+}
+
+// Format formats the snapshot's Time using layout (see the time package's
+// reference layout documentation).
+func (s *Snapshot) Format(layout string) string {
+	return s.Time.Format(layout)
+}
+
+// snapshotJSON mirrors Snapshot's fields for JSON encoding under lower-case
+// keys. Time is encoded by time.Time's own MarshalJSON, in RFC 3339 form.
+type snapshotJSON struct {
+	Hour   int       `json:"hour"`
+	Minute int       `json:"minute"`
+	Second int       `json:"second"`
+	Time   time.Time `json:"time"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Snapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(snapshotJSON{Hour: s.Hour, Minute: s.Minute, Second: s.Second, Time: s.Time})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Decoding the output of
+// MarshalJSON reproduces an equal Snapshot, modulo the monotonic reading
+// that NewSnapshot already strips.
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	var v snapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.Hour, s.Minute, s.Second, s.Time = v.Hour, v.Minute, v.Second, v.Time
+	return nil
+}
@@ -1,6 +1,7 @@
 package clock_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -8,7 +9,7 @@ import (
 	"github.com/tkdn/go-sandbox/clock"
 )
 
-func TestNewClockEquality(t *testing.T) {
+func TestNewSnapshotEquality(t *testing.T) {
 	testCases := []struct {
 		name     string
 		testTime time.Time
@@ -24,11 +25,11 @@ func TestNewClockEquality(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, want := clock.NewClock(tc.testTime), &clock.Clock{
+			got, want := clock.NewSnapshot(tc.testTime), &clock.Snapshot{
 				Hour:   tc.testTime.Hour(),
 				Minute: tc.testTime.Minute(),
 				Second: tc.testTime.Second(),
-				Time:   tc.testTime,
+				Time:   tc.testTime.Truncate(0),
 			}
 
 			if err := cmp.Diff(got, want); err != "" {
@@ -38,3 +39,93 @@ func TestNewClockEquality(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshotInReDerivesComponents(t *testing.T) {
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	s := clock.NewSnapshot(time.Date(2025, 12, 15, 17, 0, 30, 0, time.UTC))
+
+	got := s.In(jst)
+
+	want := clock.NewSnapshot(time.Date(2025, 12, 16, 2, 0, 30, 0, jst))
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("In() mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestSnapshotFormat(t *testing.T) {
+	s := clock.NewSnapshot(time.Date(2025, 12, 15, 17, 0, 30, 0, time.UTC))
+
+	got := s.Format(time.RFC3339)
+	want := "2025-12-15T17:00:30Z"
+	if got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotJSONRoundTrip(t *testing.T) {
+	want := clock.NewSnapshot(time.Date(2025, 12, 15, 17, 0, 30, 0, time.UTC))
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	got := &clock.Snapshot{}
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("round trip mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestFakeClockAdvanceFiresTimer(t *testing.T) {
+	fc := clock.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	timer := fc.NewTimer(5 * time.Second)
+
+	fc.Advance(3 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+
+	fc.Advance(2 * time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("timer did not fire once its deadline elapsed")
+	}
+}
+
+func TestFakeClockAdvanceFiresTickerRepeatedly(t *testing.T) {
+	fc := clock.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ticker := fc.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Receive after each interval: ticks that arrive while the previous one
+	// is still unread are dropped, so one large Advance yields a single tick.
+	for i := 1; i <= 3; i++ {
+		fc.Advance(time.Second)
+		select {
+		case <-ticker.C():
+		default:
+			t.Fatalf("ticker did not fire on tick %d", i)
+		}
+	}
+}
+
+func TestFakeClockSince(t *testing.T) {
+	fc := clock.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := fc.Now()
+
+	fc.Advance(90 * time.Second)
+
+	if got := fc.Since(start); got != 90*time.Second {
+		t.Errorf("Since() = %v, want %v", got, 90*time.Second)
+	}
+}
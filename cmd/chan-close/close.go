@@ -1,17 +1,30 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"fmt"
 
+	"github.com/tkdn/go-sandbox/pkg/pipeline"
+)
+
+// Generator が種となる値を流し、Map が各値を2倍にする。
+// どちらも pipeline パッケージのステージなので、ctx のキャンセルや
+// f のエラーは自動的に伝播する。
 func main() {
-	s := []int{1, 2, 3, 4, 5}
-	stream := make(chan int)
-	go func() {
-		defer close(stream)
-		for _, v := range s {
-			stream <- v * 2
-		}
-	}()
-	for v := range stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nums := pipeline.Generator(ctx, 1, 2, 3, 4, 5)
+	doubled, errs := pipeline.Map(ctx, nums, double, 1)
+
+	for v := range doubled {
 		fmt.Printf("%v \n", v)
 	}
+	if err := <-errs; err != nil {
+		fmt.Println(err)
+	}
+}
+
+func double(_ context.Context, v int) (int, error) {
+	return v * 2, nil
 }
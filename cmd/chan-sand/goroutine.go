@@ -1,22 +1,45 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/tkdn/go-sandbox/pkg/pipeline"
 )
 
+// 元々はこの2つの送信 goroutine が共通の unbuffered channel へ直接書き込んで
+// おり、2つ目の受信をコメントアウトすると main の終了とともに2つ目の goroutine
+// が送信先を失ってリークしていた。pipeline.FanIn + pipeline.OrDone を使い、
+// ctx のキャンセルで送信側も含めて片付くようにする。
 func main() {
-	stringStream := make(chan string)
-	go func() {
-		time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
-		stringStream <- "Hello Channel, 1"
-	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := delayed(ctx, "Hello Channel, 1")
+	second := delayed(ctx, "Hello Channel, 2")
+	stream := pipeline.FanIn(ctx, first, second)
+
+	fmt.Printf("%v\n", <-stream)
+	// 以下をコメントアウトしても、defer cancel() によって FanIn/delayed の
+	// goroutine は抜けるためリークしない。
+	fmt.Printf("%v\n", <-stream)
+}
+
+func delayed(ctx context.Context, msg string) <-chan string {
+	out := make(chan string)
 	go func() {
-		time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
-		stringStream <- "Hello Channel, 2"
+		defer close(out)
+		select {
+		case <-time.After(time.Duration(rand.Intn(10)) * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+		}
 	}()
-	fmt.Printf("%v\n", <-stringStream)
-	// 以下をコメントアウトするとmain実行完了となるため、2つ目の受信は捨てられる
-	fmt.Printf("%v\n", <-stringStream)
+	return out
 }
@@ -0,0 +1,235 @@
+// Package cosense は Markdown を goldmark で実際にパースし、その AST を
+// 歩いて Cosense(旧 Scrapbox) 記法へレンダリングする。main パッケージの
+// convertToConsenseFormat/mdLinkToCosenseLink が行っていた行単位のスキャンと
+// 正規表現によるリンク変換では、コードフェンス内のインデント、 "-"/"*"/"1."
+// が混在したネストリスト、インラインコード中の "[...](...)"、画像、テーブル、
+// 引用を正しく扱えなかった。実際の構文木から深さとノード種別を得ることで
+// それらを区別する。
+package cosense
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// Render は source を Markdown としてパースし、Cosense 記法に変換して w へ
+// 書き込む。baseDepth はトップレベルのブロックに付与するタブの数で、呼び出し
+// 側が見出しとなる箇条書きの下にネストさせたい場合などに使う。esaTeamURL は
+// 相対リンク(esa の内部リンク)の解決先として使う。
+func Render(w io.Writer, source []byte, baseDepth int, esaTeamURL string) error {
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	bw := bufio.NewWriter(w)
+	r := &renderer{w: bw, source: source, esaTeamURL: strings.TrimSuffix(esaTeamURL, "/")}
+	if err := r.renderBlocks(doc, baseDepth); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// renderer は1回の Render 呼び出しの間だけ使われる書き込み状態を保持する。
+type renderer struct {
+	w          *bufio.Writer
+	source     []byte
+	esaTeamURL string
+	prefix     string // Blockquote のネスト時に各行へ付与する "> " の積み重ね
+}
+
+func (r *renderer) writeLine(depth int, line string) error {
+	_, err := fmt.Fprintln(r.w, strings.Repeat("\t", depth)+r.prefix+line)
+	return err
+}
+
+// renderBlocks は parent の子ブロックを順に depth でレンダリングする。
+func (r *renderer) renderBlocks(parent ast.Node, depth int) error {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		if err := r.renderBlock(n, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *renderer) renderBlock(n ast.Node, depth int) error {
+	switch node := n.(type) {
+	case *ast.Heading:
+		return r.renderHeading(node, depth)
+	case *ast.Paragraph, *ast.TextBlock:
+		return r.renderParagraph(n, depth)
+	case *ast.List:
+		return r.renderList(node, depth)
+	case *ast.CodeBlock:
+		return r.renderCodeBlock(node.Lines(), "", depth)
+	case *ast.FencedCodeBlock:
+		return r.renderCodeBlock(node.Lines(), string(node.Language(r.source)), depth)
+	case *ast.Blockquote:
+		return r.renderBlockquote(node, depth)
+	case *ast.ThematicBreak:
+		return r.writeLine(depth, "---")
+	case *extast.Table:
+		return r.renderTable(node, depth)
+	default:
+		// HTMLBlock など未対応のブロックは子をそのまま同じ深さで展開する。
+		return r.renderBlocks(n, depth)
+	}
+}
+
+// renderHeading は見出しレベルを Cosense の装飾記法 "[* text]" に写す。
+// Scrapbox の慣習にならい、レベルが浅い(大きい見出し)ほどアスタリスクは
+// 少なくなる。
+func (r *renderer) renderHeading(h *ast.Heading, depth int) error {
+	level := h.Level
+	if level > 6 {
+		level = 6
+	}
+	marker := strings.Repeat("*", level)
+	return r.writeLine(depth, fmt.Sprintf("[%s %s]", marker, r.inlineText(h)))
+}
+
+func (r *renderer) renderParagraph(n ast.Node, depth int) error {
+	text := r.inlineText(n)
+	if text == "" {
+		return nil
+	}
+	return r.writeLine(depth, text)
+}
+
+// renderList はリスト項目を実際のネスト深さでタブに変換する。Cosense は
+// タブの数でネストを表現するため、"-"/"*"/"1." のようなマーカーの違いは
+// 出力上は区別しない(箇条書きであること自体がタブ付き行で表現される)。
+func (r *renderer) renderList(list *ast.List, depth int) error {
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		li, ok := item.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		first := li.FirstChild()
+		if first == nil {
+			continue
+		}
+		if nested, ok := first.(*ast.List); ok {
+			if err := r.renderList(nested, depth+1); err != nil {
+				return err
+			}
+		} else if err := r.writeLine(depth, r.inlineText(first)); err != nil {
+			return err
+		}
+		for sib := first.NextSibling(); sib != nil; sib = sib.NextSibling() {
+			if err := r.renderBlock(sib, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderCodeBlock はコードフェンスを "code:lang" 行とその下にネストした
+// 生のコード行として出力する。インデントはタブの深さでのみ表現するため、
+// 元の Markdown 側の空白によるインデント崩れは起きない。
+func (r *renderer) renderCodeBlock(lines *text.Segments, lang string, depth int) error {
+	if lang == "" {
+		lang = "text"
+	}
+	if err := r.writeLine(depth, "code:"+lang); err != nil {
+		return err
+	}
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		line := strings.TrimRight(string(seg.Value(r.source)), "\n")
+		if err := r.writeLine(depth+1, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderBlockquote は引用中の各行に "> " を積み重ねて付与する。
+func (r *renderer) renderBlockquote(bq *ast.Blockquote, depth int) error {
+	saved := r.prefix
+	r.prefix = saved + "> "
+	defer func() { r.prefix = saved }()
+	return r.renderBlocks(bq, depth)
+}
+
+// renderTable は GFM テーブルを Cosense のテーブル記法(table:name の下に
+// タブ区切りの行を並べる)に変換する。
+func (r *renderer) renderTable(tbl *extast.Table, depth int) error {
+	if err := r.writeLine(depth, "table:table"); err != nil {
+		return err
+	}
+	for row := tbl.FirstChild(); row != nil; row = row.NextSibling() {
+		cells := make([]string, 0)
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, r.inlineText(cell))
+		}
+		if err := r.writeLine(depth+1, strings.Join(cells, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inlineText はインラインノードの列を Cosense 記法の文字列に変換する。
+func (r *renderer) inlineText(n ast.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		r.writeInline(&sb, c)
+	}
+	return sb.String()
+}
+
+func (r *renderer) writeInline(sb *strings.Builder, n ast.Node) {
+	switch node := n.(type) {
+	case *ast.Text:
+		sb.Write(node.Segment.Value(r.source))
+		if node.SoftLineBreak() || node.HardLineBreak() {
+			sb.WriteString(" ")
+		}
+	case *ast.CodeSpan:
+		sb.WriteString("`")
+		for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+			if t, ok := c.(*ast.Text); ok {
+				sb.Write(t.Segment.Value(r.source))
+			}
+		}
+		sb.WriteString("`")
+	case *ast.Link:
+		sb.WriteString(fmt.Sprintf("[%s %s]", r.inlineText(node), r.resolveLink(string(node.Destination))))
+	case *ast.AutoLink:
+		sb.WriteString(fmt.Sprintf("[%s]", string(node.URL(r.source))))
+	case *ast.Image:
+		sb.WriteString(fmt.Sprintf("[%s]", r.resolveLink(string(node.Destination))))
+	case *ast.Emphasis:
+		text := r.inlineText(node)
+		if node.Level >= 2 {
+			sb.WriteString(fmt.Sprintf("[* %s]", text))
+		} else {
+			sb.WriteString(fmt.Sprintf("[/ %s]", text))
+		}
+	case *extast.Strikethrough:
+		sb.WriteString(fmt.Sprintf("[- %s]", r.inlineText(node)))
+	default:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			r.writeInline(sb, c)
+		}
+	}
+}
+
+// resolveLink は esa 内部リンク(相対パス)を esaTeamURL を基準にした絶対
+// URL へ解決する。すでに http(s) で始まる外部リンクはそのまま通す。
+func (r *renderer) resolveLink(link string) string {
+	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+		return link
+	}
+	return r.esaTeamURL + "/" + strings.TrimPrefix(link, "/")
+}
@@ -0,0 +1,60 @@
+package cosense_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tkdn/go-sandbox/cmd/get-til/cosense"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestRender covers the Markdown constructs that the previous regex/line-based
+// converter could not handle correctly: mixed "-"/"*"/"1." nested lists,
+// fenced code blocks, inline code containing "[...](...)", images, tables,
+// and blockquotes. Run with -update to (re)generate the .golden files.
+func TestRender(t *testing.T) {
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".md")
+
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(filepath.Join("testdata", entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := cosense.Render(&buf, source, 1, "https://esa.example.com"); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			goldenPath := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(goldenPath, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), buf.String()); diff != "" {
+				t.Errorf("Render() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
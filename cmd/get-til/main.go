@@ -2,16 +2,22 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/tkdn/go-sandbox/cmd/get-til/cosense"
+	"golang.org/x/time/rate"
 )
 
 var (
@@ -46,11 +52,11 @@ func main() {
 		return
 	}
 
-	res, err := requestEsa(esaEndpoint, authToken)
-	if err != nil {
-		logger.Error(err)
-		return
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newClient(esaEndpoint, authToken)
+	posts, errs := client.Do(ctx)
 
 	file, err := os.Create("./out/tils.txt")
 	if err != nil {
@@ -60,13 +66,17 @@ func main() {
 	defer file.Close()
 
 	writer := bufio.NewWriter(file)
-	for _, p := range res.Posts {
+	for p := range posts {
 		reader := strings.NewReader(p.BodyMarkdown)
 		if err := pipeline(reader, writer, p.EsaTitle, esaTeamURL); err != nil {
 			logger.Error(err)
 			return
 		}
 	}
+	if err := <-errs; err != nil {
+		logger.Error(err)
+		return
+	}
 	if err := writer.Flush(); err != nil {
 		logger.Error(err)
 		return
@@ -74,35 +84,205 @@ func main() {
 	logger.Info("completed: ファイルに書き込みました")
 }
 
-type esaRes struct {
+// Post は esa から取得した1件の記事を表す。Client.Do はページングをまたいで
+// 取得した Post をこの型のまま channel へ流す。
+type Post struct {
+	BodyMarkdown string
+	EsaTitle     string
+}
+
+type esaResponse struct {
 	Posts []struct {
 		BodyMarkdown string `json:"body_md"`
 		EsaTitle     string `json:"full_name"`
 	} `json:"posts"`
+	NextPage *int `json:"next_page"`
+}
+
+const (
+	// requestsPerSecond は esa API へのリクエストレート上限を表す。
+	requestsPerSecond = 5
+
+	// maxRetries は1ページあたりのリトライ上限回数を表す。
+	maxRetries = 5
+
+	// baseBackoff/maxBackoff はリトライ間隔(ジッター適用前)の下限・上限を表す。
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+)
+
+// Client は esa API からの TIL 記事取得を担う。requestEsa が単一ページ・
+// リトライなしだったのに対し、ページング・レート制限・リトライを内包する。
+type Client struct {
+	endpoint   string
+	authToken  string
+	httpClient *http.Client
+	limiter    *rate.Limiter
+}
+
+// newClient は esa API の endpoint と認証トークンを受け取り Client を初期化する。
+func newClient(endpoint, authToken string) *Client {
+	return &Client{
+		endpoint:   endpoint,
+		authToken:  authToken,
+		httpClient: &http.Client{},
+		limiter:    rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+	}
+}
+
+// Do は next_page を辿りながら全ページを取得し、Post を posts channel へ流す。
+// 各ページの取得はレート制限の範囲内で行われ、429/5xx やネットワークエラーは
+// Retry-After を尊重した指数バックオフ+ジッターでリトライする。全ページ取得後・
+// ctx キャンセル時・リトライ上限到達後に posts を close し、errs へ最終的な
+// エラー(成功時は nil)を1件だけ送る。呼び出し側は posts を range しながら
+// 後続ページの取得と並行に変換処理を進められる。
+func (c *Client) Do(ctx context.Context) (<-chan Post, <-chan error) {
+	posts := make(chan Post)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(posts)
+
+		page := 1
+		for {
+			if err := c.limiter.Wait(ctx); err != nil {
+				errs <- err
+				return
+			}
+			res, err := c.fetchPageWithRetry(ctx, page)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, p := range res.Posts {
+				select {
+				case posts <- Post{BodyMarkdown: p.BodyMarkdown, EsaTitle: p.EsaTitle}:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			if res.NextPage == nil {
+				errs <- nil
+				return
+			}
+			page = *res.NextPage
+		}
+	}()
+
+	return posts, errs
+}
+
+// httpStatusError は esa API が non-2xx を返したことを表す。retryAfter は
+// レスポンスの Retry-After ヘッダから解釈した待機時間(なければ 0)を保持する。
+type httpStatusError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("esa API responded with status %d", e.statusCode)
+}
+
+// isRetryable は err がリトライして解決する見込みのあるものかどうかを判定する。
+// 429/5xx はリトライ対象、それ以外の non-2xx(認証エラーなど)は対象外。
+// httpStatusError でない場合はネットワークレベルのエラーとみなしリトライする。
+func isRetryable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// fetchPageWithRetry は1ページ分の取得を、リトライ可能なエラーに対しては
+// 指数バックオフ+ジッターで maxRetries 回まで再試行する。
+func (c *Client) fetchPageWithRetry(ctx context.Context, page int) (*esaResponse, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		res, err := c.fetchPage(ctx, page)
+		if err == nil {
+			return res, nil
+		}
+		lastErr = err
+		if attempt == maxRetries || !isRetryable(err) {
+			break
+		}
+
+		var retryAfter time.Duration
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) {
+			retryAfter = statusErr.retryAfter
+		}
+
+		select {
+		case <-time.After(backoffDelay(attempt, retryAfter)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("fetch page %d: %w", page, lastErr)
+}
+
+// backoffDelay は attempt 回目(0-indexed)のリトライ待機時間を計算する。
+// Retry-After が指定されていればそれを優先し、なければ baseBackoff を
+// 2^attempt で伸ばし maxBackoff で頭打ちにしたうえで equal jitter を適用する。
+func backoffDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	delay := baseBackoff * time.Duration(1<<attempt)
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
 }
 
-func requestEsa(endpoint, authToken string) (*esaRes, error) {
-	reqURL := buildRequestURL(endpoint)
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+// fetchPage は esa API から1ページ分のレスポンスを取得する。
+func (c *Client) fetchPage(ctx context.Context, page int) (*esaResponse, error) {
+	reqURL := buildRequestURL(c.endpoint, page)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Bearer "+authToken)
+	req.Header.Add("Authorization", "Bearer "+c.authToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var res esaRes
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{
+			statusCode: resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	var res esaResponse
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return nil, err
 	}
 	return &res, nil
 }
 
+// parseRetryAfter は Retry-After ヘッダを解釈する。秒数表現・HTTP-date 表現の
+// どちらにも対応し、解釈できなければ 0 を返す(呼び出し側でバックオフに委ねる)。
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
 var (
 	queryKeyVal = map[string]string{
 		"in":      "日報",
@@ -113,7 +293,7 @@ var (
 	postPerPage = "100"
 )
 
-func buildRequestURL(endpoint string) string {
+func buildRequestURL(endpoint string, page int) string {
 	u, _ := url.Parse(endpoint)
 	qa := make([]string, 0, len(queryKeyVal))
 	for k, v := range queryKeyVal {
@@ -123,25 +303,24 @@ func buildRequestURL(endpoint string) string {
 	query := url.Values{}
 	query.Add("q", qs)
 	query.Add("per_page", postPerPage)
+	query.Add("page", strconv.Itoa(page))
 	u.RawQuery = query.Encode()
 	return u.String()
 }
 
-func extractTILSection(input io.Reader, output io.Writer, title string) error {
+// extractTILSection は投稿の Markdown 本文から「# わかったこと」見出し配下の
+// セクションだけを抜き出す。見出し自体やセクション外の内容は含めず、本文の
+// Markdown 記法はそのまま返すので、呼び出し側で goldmark によって正しく
+// パースできる。セクションはその後に現れる "#" で始まる最初の行(サブ見出しや
+// コードフェンス内の "#" 行を含む)の直前で終わる。
+func extractTILSection(input io.Reader) (string, error) {
 	tilHeading := "# わかったこと"
 	collect := false
 
+	var buf strings.Builder
 	scanner := bufio.NewScanner(input)
-	writer := bufio.NewWriter(output)
-	defer writer.Flush()
-
-	fmt.Fprintln(writer, "- "+title)
 	for scanner.Scan() {
 		line := scanner.Text()
-		// ignore blank space
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
 		// detect not til heading. checke til section had been already collected
 		if strings.HasPrefix(line, "#") && line != tilHeading {
 			if collect {
@@ -153,72 +332,21 @@ func extractTILSection(input io.Reader, output io.Writer, title string) error {
 			continue
 		}
 		if collect {
-			fmt.Fprintln(writer, "  "+line)
-		}
-	}
-	return scanner.Err()
-}
-
-func convertToConsenseFormat(input io.Reader, output io.Writer, esaTeamURL string) error {
-	scanner := bufio.NewScanner(input)
-	writer := bufio.NewWriter(output)
-	defer writer.Flush()
-
-	prevLine := "- TIL"
-	indentLevel := 1
-	for scanner.Scan() {
-		currentLine := scanner.Text()
-		trimedCurrentLine := strings.TrimLeft(currentLine, "- ")
-		currentSpaces := len(currentLine) - len(trimedCurrentLine)
-		trimedPrevLine := strings.TrimLeft(prevLine, "- ")
-		prevSpaces := len(prevLine) - len(trimedPrevLine)
-
-		if currentSpaces > 0 {
-			if currentSpaces > prevSpaces {
-				indentLevel++
-			} else if currentSpaces < prevSpaces {
-				indentLevel--
-			}
-		} else {
-			indentLevel = 1
+			buf.WriteString(line)
+			buf.WriteString("\n")
 		}
-		consensedLine := mdLinkToCosenseLink(trimedCurrentLine, esaTeamURL)
-		indent := strings.Repeat("\t", indentLevel)
-		fmt.Fprintln(writer, indent+consensedLine)
-		prevLine = currentLine
 	}
-	return scanner.Err()
-}
-
-func mdLinkToCosenseLink(markdown, esaTeamURL string) string {
-	re := regexp.MustCompile(`\[(.*?)\]\((.*?)\)`)
-
-	line := re.ReplaceAllStringFunc(markdown, func(match string) string {
-		matches := re.FindStringSubmatch(match)
-		if len(match) > 2 {
-			text := matches[1]
-			link := matches[2]
-			if !strings.HasPrefix(link, "http") {
-				link = esaTeamURL + link
-			}
-			return fmt.Sprintf("[%s %s]", text, link)
-		}
-		return match
-	})
-	return line
+	return buf.String(), scanner.Err()
 }
 
 func pipeline(input io.Reader, output io.Writer, title, esaTeamURL string) error {
-	pr, pw := io.Pipe()
+	section, err := extractTILSection(input)
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		defer pw.Close()
-		if err := extractTILSection(input, pw, title); err != nil {
-			pw.CloseWithError(err)
-		}
-	}()
-	if err := convertToConsenseFormat(pr, output, esaTeamURL); err != nil {
+	if _, err := fmt.Fprintln(output, "- "+title); err != nil {
 		return err
 	}
-	return nil
+	return cosense.Render(output, []byte(section), 1, esaTeamURL)
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelayRetryAfterTakesPrecedence(t *testing.T) {
+	got := backoffDelay(3, 5*time.Second)
+	if want := 5 * time.Second; got != want {
+		t.Errorf("backoffDelay() = %v, want %v", got, want)
+	}
+}
+
+func TestBackoffDelayExponentialWithinBounds(t *testing.T) {
+	testCases := []struct {
+		name       string
+		attempt    int
+		wantMin    time.Duration
+		wantMaxCap time.Duration
+	}{
+		{name: "first attempt", attempt: 0, wantMin: 250 * time.Millisecond, wantMaxCap: 500 * time.Millisecond},
+		{name: "capped at maxBackoff", attempt: 10, wantMin: 15 * time.Second, wantMaxCap: maxBackoff},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := backoffDelay(tc.attempt, 0)
+			if got < tc.wantMin || got > tc.wantMaxCap {
+				t.Errorf("backoffDelay(%d, 0) = %v, want in [%v, %v]", tc.attempt, got, tc.wantMin, tc.wantMaxCap)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "429 too many requests", err: &httpStatusError{statusCode: http.StatusTooManyRequests}, want: true},
+		{name: "503 service unavailable", err: &httpStatusError{statusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "500 internal server error", err: &httpStatusError{statusCode: http.StatusInternalServerError}, want: true},
+		{name: "404 not found", err: &httpStatusError{statusCode: http.StatusNotFound}, want: false},
+		{name: "401 unauthorized", err: &httpStatusError{statusCode: http.StatusUnauthorized}, want: false},
+		{name: "non-status error", err: errors.New("connection reset"), want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryable(tc.err); got != tc.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+// page1 と page2 を返す esa API のモック。page1 はレート制限・リトライの
+// 挙動をテストするため、failFirst 回だけ 503 を返してからレスポンスを返す。
+func newPaginatedEsaServer(t *testing.T, failFirst int32) *httptest.Server {
+	t.Helper()
+	var page1Attempts atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/posts", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			if page1Attempts.Add(1) <= failFirst {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"posts":[{"body_md":"# わかったこと\nfirst","full_name":"day1/first"}],"next_page":2}`))
+		case "2":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"posts":[{"body_md":"# わかったこと\nsecond","full_name":"day2/second"}],"next_page":null}`))
+		default:
+			t.Fatalf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClientDoFollowsPagination(t *testing.T) {
+	srv := newPaginatedEsaServer(t, 0)
+	defer srv.Close()
+
+	c := newClient(srv.URL+"/v1/posts", "token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	posts, errs := c.Do(ctx)
+
+	var got []Post
+	for p := range posts {
+		got = append(got, p)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d posts, want 2: %+v", len(got), got)
+	}
+	if got[0].EsaTitle != "day1/first" || got[1].EsaTitle != "day2/second" {
+		t.Errorf("got posts %+v, want page1 then page2", got)
+	}
+}
+
+func TestClientDoRetriesRetryableErrors(t *testing.T) {
+	srv := newPaginatedEsaServer(t, 1)
+	defer srv.Close()
+
+	c := newClient(srv.URL+"/v1/posts", "token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	posts, errs := c.Do(ctx)
+
+	var got []Post
+	for p := range posts {
+		got = append(got, p)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Do() error = %v, want nil after retrying the transient 503", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d posts, want 2: %+v", len(got), got)
+	}
+}
+
+func TestClientDoGivesUpOnNonRetryableError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c := newClient(srv.URL, "token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	posts, errs := c.Do(ctx)
+
+	for range posts {
+	}
+	if err := <-errs; err == nil {
+		t.Fatal("Do() error = nil, want an error for a non-retryable 401")
+	}
+}
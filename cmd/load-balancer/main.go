@@ -2,10 +2,18 @@ package main
 
 import (
 	"container/heap"
-	"fmt"
+	"context"
+	"log/slog"
 	"math"
 	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/tkdn/go-sandbox/clock"
 )
 
 // Rob Pike が 2012 waza にて講演した "Concurrency is not Prallelism" における
@@ -27,19 +35,71 @@ import (
 //	- Worker は sin(data) を res channel へ書き込む(Request 構造体で返す)
 //
 // チャンネルは計4つ登場する。req, res, work, done
+//
+// ctx がキャンセルされると LB は req の受付を止め、稼働中の Worker の完了(またはタイムアウト)を
+// 待ってから終了する。Worker 数は print() 相当の pending 分散(variance)の観測にもとづき
+// autoscale() が増減させる。
+
+const (
+	// reqClientCount はリクエストするクライアントの数を表す。
+	reqClientCount = 100
 
-// reqClientCount はリクエストするクライアントの数を表す。
-const reqClientCount = 100
+	// defaultWorkerSize は起動時に用意する Worker の数のデフォルト値を表す。
+	defaultWorkerSize = 10
+	// defaultMinWorkers は autoscale で縮退させる下限の Worker 数のデフォルト値を表す。
+	defaultMinWorkers = 2
+	// defaultMaxWorkers は autoscale で増強させる上限の Worker 数のデフォルト値を表す。
+	defaultMaxWorkers = 50
 
-// workerSize はリクエストを処理する Worker の数を表す。
-const workerSize = 10
+	// defaultRequestTimeout は Worker が計算結果を res channel へ書き込む際、
+	// クライアントが読み出さない場合に諦めるまでの時間のデフォルト値を表す。
+	defaultRequestTimeout = 50 * time.Millisecond
+
+	// defaultMetricsInterval は load balancer のメトリクスを slog で出力する
+	// 間隔のデフォルト値を表す。
+	defaultMetricsInterval = 2 * time.Second
+
+	// varianceHighThreshold/varianceLowThreshold は autoscale の閾値を表す。
+	// pending の分散がこれより高ければ Worker を増やし、低ければ減らす。
+	varianceHighThreshold = 50.0
+	varianceLowThreshold  = 5.0
+)
+
+// Config は newLoadBalancer の挙動を調整するパラメータを表す。
+// ゼロ値のフィールドは DefaultConfig の対応する値で埋める (see newLoadBalancer)。
+type Config struct {
+	WorkerSize      int
+	MinWorkers      int
+	MaxWorkers      int
+	Timeout         time.Duration
+	MetricsInterval time.Duration
+}
+
+// DefaultConfig はこれまで定数として埋め込まれていた規定値をまとめたもの。
+func DefaultConfig() Config {
+	return Config{
+		WorkerSize:      defaultWorkerSize,
+		MinWorkers:      defaultMinWorkers,
+		MaxWorkers:      defaultMaxWorkers,
+		Timeout:         defaultRequestTimeout,
+		MetricsInterval: defaultMetricsInterval,
+	}
+}
+
+// logger は load balancer のメトリクスや状態遷移を構造化ログとして出力する。
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	clk := clock.NewRealClock()
+
 	req := make(chan Request)
 	for range reqClientCount {
-		go createRequest(req)
+		go createRequest(ctx, clk, req)
 	}
-	newLoadBalancer().balance(req)
+	newLoadBalancer(ctx, clk, DefaultConfig()).balance(ctx, req)
 }
 
 // Request は LB へ送られるリクエストを表現した構造体。
@@ -52,35 +112,106 @@ type Request struct {
 // どのクライアントも無限ループするgoroutineで、
 // ループ内ではLB(で待ち受けるチャンネル)へ送信するリクエスト(Request)を生成している。
 // レスポンスについては、リクエストはクライアントごとに共通のチャンネルを使用する。
-func createRequest(req chan Request) {
+// ctx がキャンセルされた場合は送受信の途中であっても直ちに終了する。
+// sleep の待ち受けには clk を使うため、テストでは FakeClock を渡して
+// 実時間の待ちなしに決定的に駆動できる。
+func createRequest(ctx context.Context, clk clock.Clock, req chan<- Request) {
 	res := make(chan float64)
 	for {
 		// ランダムにsleepを入れる
-		time.Sleep(time.Duration(rand.Int63n(int64(time.Millisecond))))
-		req <- Request{int(rand.Int31n(90)), res}
+		select {
+		case <-clk.NewTimer(time.Duration(rand.Int63n(int64(time.Millisecond)))).C():
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case req <- Request{int(rand.Int31n(90)), res}:
+		case <-ctx.Done():
+			return
+		}
 		// チャンネルからレスポンスを読み込む
-		<-res
+		select {
+		case <-res:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
 // Worker は LB からのリクエスト処理を受け付ける構造体。
 type Worker struct {
-	idx     int          // ヒープインデックス
-	work    chan Request // work チャンネル
-	pending int          // このWorkerがどれだけリクエストを保留しているかの数
+	idx     int           // ヒープインデックス
+	work    chan Request  // work チャンネル
+	pending int           // このWorkerがどれだけリクエストを保留しているかの数
+	quit    chan struct{} // RemoveWorker によって個別に停止させるためのチャンネル
+	timeout time.Duration // res channel への書き込みを諦めるまでの時間
+	clk     clock.Clock   // respond のタイムアウト計測に使う Clock
 }
 
-// do は無限ループする Worker goroutine を開始する。
+// do は Worker goroutine を開始する。
 // ループ内では Request 構造体(と構造体におけるdata計算)を待ち構え、done channel はブロックされる。
 // Worker は複数のリクエストを受け付け、保留中のリクエストはリクエスト数を記録する。
-func (w *Worker) do(done chan *Worker) {
+// ctx のキャンセルか quit の close で抜ける。quit は RemoveWorker による個別停止、
+// ctx は LB 全体のシャットダウンに対応し、いずれの場合も処理中の1件は最後まで
+// 終わらせてから(タイムアウトで諦めた場合を含め)抜けるため、呼び出し側の wg.Wait() は
+// 安全に待ち合わせできる。select は ctx.Done()/quit と w.work を対等に扱うため、
+// どちらが選ばれるかは保証されない。w.work にはすでに dispatch 済みの
+// キュー済みリクエストが残っている可能性があるので、抜ける直前に必ず
+// drain してから return し、黙って見捨てられるリクエストが出ないようにする。
+func (w *Worker) do(ctx context.Context, done chan<- *Worker, wg *sync.WaitGroup, dropped *atomic.Int64) {
+	defer wg.Done()
 	for {
-		// work channel からリクエストを抽出する
-		req := <-w.work
-		// res channel へ計算結果を書き込む
-		req.res <- math.Sin(float64(req.data))
-		// done channel へ書き込む
-		done <- w
+		select {
+		case <-ctx.Done():
+			w.drain(ctx, dropped)
+			return
+		case <-w.quit:
+			w.drain(ctx, dropped)
+			return
+		case req := <-w.work:
+			w.respond(ctx, req, dropped)
+			select {
+			case done <- w:
+			case <-ctx.Done():
+				w.drain(ctx, dropped)
+				return
+			}
+		}
+	}
+}
+
+// drain は w.work にまだ残っているキュー済みの Request を同期的に処理しきる。
+// LB のシャットダウン時は ctx がキャンセル済みのため、respond は即座に
+// ctx.Done() 分岐に入り dropped へカウントする(クライアントが res を
+// 読み出す可能性は基本的にない)。quit による個別停止では ctx はまだ生きており、
+// respond は通常どおりクライアントの読み出しか w.timeout を待つ。
+// w.work が空になり次第 default に落ちて戻る。
+func (w *Worker) drain(ctx context.Context, dropped *atomic.Int64) {
+	for {
+		select {
+		case req := <-w.work:
+			w.respond(ctx, req, dropped)
+		default:
+			return
+		}
+	}
+}
+
+// respond は計算結果を res channel へ書き込む。クライアントが w.timeout 以内に
+// 読み出さない場合、あるいは ctx がキャンセルされた場合はブロックせず破棄する。
+func (w *Worker) respond(ctx context.Context, req Request, dropped *atomic.Int64) {
+	result := math.Sin(float64(req.data))
+
+	timer := w.clk.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	select {
+	case req.res <- result:
+	case <-timer.C():
+		dropped.Add(1)
+		logger.Warn("dropped response: client did not read within timeout", "data", req.data, "timeout", w.timeout)
+	case <-ctx.Done():
+		dropped.Add(1)
 	}
 }
 
@@ -90,46 +221,165 @@ type Pool []*Worker
 // LoadBalancer は LB を表現した構造体。
 // done チャンネルでは Worker からの書き込みを期待し、
 // heap に通知することで pending カウンタを減少させる。
+// pool とそのカウンタは balance() を実行する goroutine だけが所有し、
+// addWorkerCh/removeWorkerCh 経由で外部からの増減要求を受け取る。
 type LoadBalancer struct {
 	pool Pool
 	done chan *Worker
+
+	addWorkerCh    chan struct{}
+	removeWorkerCh chan struct{}
+
+	wg sync.WaitGroup
+
+	clk             clock.Clock
+	timeout         time.Duration
+	metricsInterval time.Duration
+	minWorkers      int
+	maxWorkers      int
+
+	dispatchedCount int
+	completedCount  int
+	dropped         atomic.Int64
 }
 
 // newLoadBalancer は LB の初期化を行う。
-// Workerプールの数、リクエスト数を読み込み、
-// heap に規定の数だけ Worker を作成しプールする。
-// 作成された Worker は goroutin を開始して処理待ち構える。
-func newLoadBalancer() *LoadBalancer {
-	done := make(chan *Worker, workerSize)
-	b := &LoadBalancer{make(Pool, 0, workerSize), done}
-	for range workerSize {
-		w := &Worker{work: make(chan Request, reqClientCount)}
-		heap.Push(&b.pool, w)
-		go w.do(b.done)
+// cfg でプールサイズやタイムアウト・メトリクス間隔を指定でき、ゼロ値の
+// フィールドは DefaultConfig の値で埋める。heap に cfg.WorkerSize 個の
+// Worker を作成しプールし、各 Worker は goroutine を開始して ctx の
+// キャンセルまで処理を待ち構える。clk は Worker のタイムアウト計測と
+// metricsInterval の ticker に使われ、テストでは FakeClock を渡すことで
+// 実時間の待ちなしに駆動できる。
+func newLoadBalancer(ctx context.Context, clk clock.Clock, cfg Config) *LoadBalancer {
+	def := DefaultConfig()
+	if cfg.WorkerSize == 0 {
+		cfg.WorkerSize = def.WorkerSize
+	}
+	if cfg.MinWorkers == 0 {
+		cfg.MinWorkers = def.MinWorkers
+	}
+	if cfg.MaxWorkers == 0 {
+		cfg.MaxWorkers = def.MaxWorkers
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.MetricsInterval == 0 {
+		cfg.MetricsInterval = def.MetricsInterval
+	}
+
+	b := &LoadBalancer{
+		pool:            make(Pool, 0, cfg.MaxWorkers),
+		done:            make(chan *Worker, cfg.MaxWorkers),
+		addWorkerCh:     make(chan struct{}, 1),
+		removeWorkerCh:  make(chan struct{}, 1),
+		clk:             clk,
+		timeout:         cfg.Timeout,
+		metricsInterval: cfg.MetricsInterval,
+		minWorkers:      cfg.MinWorkers,
+		maxWorkers:      cfg.MaxWorkers,
+	}
+	for range cfg.WorkerSize {
+		b.addWorker(ctx)
 	}
 	return b
 }
 
 // balance は req channel で Request を待ち構え req を dispatch し、
-// done channel で完了を待ち構える。バランスの結果を出力する。
-func (b *LoadBalancer) balance(req chan Request) {
+// done channel で完了を待ち構える。ctx がキャンセルされると req の受付を止め、
+// 稼働中の Worker の完了を待ってから戻る。AddWorker/RemoveWorker からの増減要求も
+// ここで処理し、metricsInterval ごとにメトリクスを出力し autoscale する。
+func (b *LoadBalancer) balance(ctx context.Context, req <-chan Request) {
+	ticker := b.clk.NewTicker(b.metricsInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ctx.Done():
+			b.shutdown()
+			return
 		case request := <-req:
 			b.dispatch(request)
 		case w := <-b.done:
 			b.completed(w)
+		case <-b.addWorkerCh:
+			b.addWorker(ctx)
+		case <-b.removeWorkerCh:
+			b.removeWorker()
+		case <-ticker.C():
+			b.reportMetrics()
+			b.autoscale(ctx)
 		}
-		b.print()
 	}
 }
 
+// shutdown は稼働中の Worker が処理中のリクエストを drain するのを待ってから戻る。
+func (b *LoadBalancer) shutdown() {
+	logger.Info("load balancer shutting down, draining in-flight requests")
+	b.wg.Wait()
+	logger.Info("load balancer shut down",
+		"dispatched", b.dispatchedCount,
+		"completed", b.completedCount,
+		"dropped", b.dropped.Load(),
+	)
+}
+
+// AddWorker は Worker プールを1つ増やすよう balance() の goroutine に要求する。
+// すでに追加要求が1件溜まっている場合、1件反映されれば十分なため新しい要求はブロックせず破棄する。
+func (b *LoadBalancer) AddWorker() {
+	select {
+	case b.addWorkerCh <- struct{}{}:
+	default:
+	}
+}
+
+// RemoveWorker は Worker プールを1つ減らすよう balance() の goroutine に要求する。
+// AddWorker 同様ブロックせず破棄する。
+func (b *LoadBalancer) RemoveWorker() {
+	select {
+	case b.removeWorkerCh <- struct{}{}:
+	default:
+	}
+}
+
+// addWorker は Worker を1つ作成し heap に登録して goroutine を開始する。
+// balance() を実行する goroutine からのみ呼び出されるため pool の操作にロックは不要。
+func (b *LoadBalancer) addWorker(ctx context.Context) {
+	if len(b.pool) >= b.maxWorkers {
+		return
+	}
+	w := &Worker{
+		work:    make(chan Request, reqClientCount),
+		quit:    make(chan struct{}),
+		timeout: b.timeout,
+		clk:     b.clk,
+	}
+	heap.Push(&b.pool, w)
+	b.wg.Add(1)
+	go w.do(ctx, b.done, &b.wg, &b.dropped)
+}
+
+// removeWorker は最も pending の少ない Worker を1つ停止する。
+// pending が残っている Worker を外すとそのリクエストが宙に浮くため、
+// heap の先頭(最小 pending)が 0 のときだけ取り除く。
+func (b *LoadBalancer) removeWorker() {
+	if len(b.pool) <= b.minWorkers {
+		return
+	}
+	if b.pool[0].pending > 0 {
+		return
+	}
+	w := heap.Pop(&b.pool).(*Worker)
+	close(w.quit)
+}
+
 // dispatch は最も負荷の低い Worker へ処理を渡し heap を更新する。
 func (b *LoadBalancer) dispatch(req Request) {
 	w := heap.Pop(&b.pool).(*Worker)
 	w.work <- req
 	w.pending++
 	heap.Push(&b.pool, w)
+	b.dispatchedCount++
 }
 
 // completed は Worker の保留数を減退させ heap から削除し Pool に書き戻す。
@@ -137,20 +387,46 @@ func (b *LoadBalancer) completed(w *Worker) {
 	w.pending--
 	heap.Remove(&b.pool, w.idx)
 	heap.Push(&b.pool, w)
+	b.completedCount++
 }
 
-// print はバランス結果を出力する。
-func (b *LoadBalancer) print() {
-	sum := 0
-	sumsq := 0
+// stats は pool 全体の pending の平均と分散を計算する。
+func (b *LoadBalancer) stats() (avg, variance float64) {
+	sum, sumsq := 0, 0
 	for _, w := range b.pool {
-		fmt.Printf("%d ", w.pending)
 		sum += w.pending
 		sumsq += w.pending * w.pending
 	}
-	avg := float64(sum) / float64(len(b.pool))
-	variance := float64(sumsq)/float64(len(b.pool)) - avg*avg
-	fmt.Printf(" %.2f %.2f\n", avg, variance)
+	avg = float64(sum) / float64(len(b.pool))
+	variance = float64(sumsq)/float64(len(b.pool)) - avg*avg
+	return avg, variance
+}
+
+// reportMetrics は pool の状態を構造化ログとして出力する。以前は print() が
+// fmt.Printf で pending ごとの分布と avg/variance を出していたが、dispatched/
+// completed/dropped も併せて観測できるよう slog での構造化出力に置き換えた。
+func (b *LoadBalancer) reportMetrics() {
+	avg, variance := b.stats()
+	logger.Info("load balancer metrics",
+		"workers", len(b.pool),
+		"avg_pending", avg,
+		"variance", variance,
+		"dispatched", b.dispatchedCount,
+		"completed", b.completedCount,
+		"dropped", b.dropped.Load(),
+	)
+}
+
+// autoscale は pending の分散が varianceHighThreshold を超えていれば Worker を増やし、
+// varianceLowThreshold を下回っていれば減らす。
+func (b *LoadBalancer) autoscale(ctx context.Context) {
+	_, variance := b.stats()
+	switch {
+	case variance > varianceHighThreshold:
+		b.addWorker(ctx)
+	case variance < varianceLowThreshold:
+		b.removeWorker()
+	}
 }
 
 // 以下は heap.Interface を満たすための実装
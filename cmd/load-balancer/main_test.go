@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tkdn/go-sandbox/clock"
+)
+
+func TestLoadBalancerDispatchCompletes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      1,
+		MinWorkers:      1,
+		MaxWorkers:      2,
+		Timeout:         time.Second,
+		MetricsInterval: time.Hour,
+	})
+
+	req := make(chan Request)
+	go lb.balance(ctx, req)
+
+	res := make(chan float64)
+	select {
+	case req <- Request{data: 0, res: res}:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked: load balancer did not accept the request")
+	}
+
+	select {
+	case got := <-res:
+		if want := math.Sin(0); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker never responded")
+	}
+}
+
+func TestLoadBalancerDropsResponseOnTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      1,
+		MinWorkers:      1,
+		MaxWorkers:      2,
+		Timeout:         50 * time.Millisecond,
+		MetricsInterval: time.Hour,
+	})
+
+	req := make(chan Request)
+	go lb.balance(ctx, req)
+
+	// Nobody ever reads from res, so the worker must fall back to its
+	// timeout. The timer is registered on a goroutine we don't synchronize
+	// with directly, so nudge the fake clock forward until the drop lands.
+	select {
+	case req <- Request{data: 0, res: make(chan float64)}:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked: load balancer did not accept the request")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for lb.dropped.Load() == 0 && time.Now().Before(deadline) {
+		clk.Advance(50 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	if got := lb.dropped.Load(); got != 1 {
+		t.Fatalf("dropped = %d, want 1", got)
+	}
+}
+
+func TestLoadBalancerShutdownDrainsInFlightRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      1,
+		MinWorkers:      1,
+		MaxWorkers:      2,
+		Timeout:         time.Second,
+		MetricsInterval: time.Hour,
+	})
+
+	req := make(chan Request)
+	balanceDone := make(chan struct{})
+	go func() {
+		lb.balance(ctx, req)
+		close(balanceDone)
+	}()
+
+	// Dispatch a request nobody reads, so it is still in flight (waiting on
+	// its timeout/ctx) when we cancel, then make sure shutdown drains it
+	// instead of balance() hanging or returning before the worker is done.
+	select {
+	case req <- Request{data: 0, res: make(chan float64)}:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked: load balancer did not accept the request")
+	}
+
+	cancel()
+	select {
+	case <-balanceDone:
+	case <-time.After(time.Second):
+		t.Fatal("balance() did not return after ctx cancellation: shutdown did not drain in-flight workers")
+	}
+}
+
+func TestLoadBalancerShutdownDrainsQueuedRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      1,
+		MinWorkers:      1,
+		MaxWorkers:      2,
+		Timeout:         time.Second,
+		MetricsInterval: time.Hour,
+	})
+
+	req := make(chan Request)
+	balanceDone := make(chan struct{})
+	go func() {
+		lb.balance(ctx, req)
+		close(balanceDone)
+	}()
+
+	// The single worker can only actively process one request at a time, so
+	// with nobody reading res, every request after the first backs up in
+	// Worker.work (buffered, capacity reqClientCount) as already-dispatched,
+	// queued work.
+	const n = 5
+	for range n {
+		select {
+		case req <- Request{data: 0, res: make(chan float64)}:
+		case <-time.After(time.Second):
+			t.Fatal("dispatch blocked: load balancer did not accept the request")
+		}
+	}
+
+	cancel()
+	select {
+	case <-balanceDone:
+	case <-time.After(time.Second):
+		t.Fatal("balance() did not return after ctx cancellation")
+	}
+
+	if got := lb.dropped.Load(); got != n {
+		t.Errorf("dropped = %d, want %d: queued requests were abandoned instead of drained", got, n)
+	}
+}
+
+func TestLoadBalancerAddWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      1,
+		MinWorkers:      1,
+		MaxWorkers:      3,
+		Timeout:         time.Second,
+		MetricsInterval: time.Hour,
+	})
+
+	// Queue the AddWorker request before balance() starts, so addWorkerCh is
+	// already ready on balance()'s first select and stays ready until it is
+	// serviced.
+	lb.AddWorker()
+
+	req := make(chan Request)
+	balanceDone := make(chan struct{})
+	go func() {
+		lb.balance(ctx, req)
+		close(balanceDone)
+	}()
+
+	// Round-trip a request before cancelling. balance() runs a single select
+	// loop, one ready channel at a time; if it picks the request first,
+	// addWorkerCh is still ready on the iterations that follow.
+	res := make(chan float64)
+	select {
+	case req <- Request{data: 0, res: res}:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked: load balancer did not accept the request")
+	}
+	select {
+	case <-res:
+	case <-time.After(time.Second):
+		t.Fatal("worker never responded")
+	}
+
+	cancel()
+	select {
+	case <-balanceDone:
+	case <-time.After(time.Second):
+		t.Fatal("balance() did not return after ctx cancellation")
+	}
+	if got, want := len(lb.pool), 2; got != want {
+		t.Errorf("pool size = %d, want %d (initial worker + AddWorker)", got, want)
+	}
+}
+
+func TestLoadBalancerRemoveWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewFakeClock(time.Unix(0, 0))
+	lb := newLoadBalancer(ctx, clk, Config{
+		WorkerSize:      2,
+		MinWorkers:      1,
+		MaxWorkers:      3,
+		Timeout:         time.Second,
+		MetricsInterval: time.Hour,
+	})
+
+	lb.RemoveWorker()
+
+	req := make(chan Request)
+	balanceDone := make(chan struct{})
+	go func() {
+		lb.balance(ctx, req)
+		close(balanceDone)
+	}()
+
+	res := make(chan float64)
+	select {
+	case req <- Request{data: 0, res: res}:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked: load balancer did not accept the request")
+	}
+	select {
+	case <-res:
+	case <-time.After(time.Second):
+		t.Fatal("worker never responded")
+	}
+
+	cancel()
+	select {
+	case <-balanceDone:
+	case <-time.After(time.Second):
+		t.Fatal("balance() did not return after ctx cancellation")
+	}
+	if got, want := len(lb.pool), 1; got != want {
+		t.Errorf("pool size = %d, want %d (initial workers - RemoveWorker)", got, want)
+	}
+}
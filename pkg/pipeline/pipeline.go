@@ -0,0 +1,172 @@
+// Package pipeline provides small, generic building blocks for channel-based
+// concurrency pipelines: generating a stream, fanning it out to multiple
+// workers, fanning the results back in, and mapping over it with bounded
+// concurrency. Every stage honors context cancellation and closes its output
+// channel once the input is drained. A consumer that stops ranging early must
+// cancel ctx; the stage goroutines then exit instead of blocking on a send.
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Generator starts a goroutine that sends each of values on the returned
+// channel, then closes it. It stops early if ctx is canceled.
+func Generator[T any](ctx context.Context, values ...T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for _, v := range values {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// OrDone wraps ch so that ranging over the returned channel also stops as
+// soon as ctx is canceled, even if ch's sender is blocked or gone. Without
+// this, a goroutine blocked sending on ch leaks forever once the receiver
+// stops ranging over it.
+func OrDone[T any](ctx context.Context, ch <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// FanOut distributes values from in across n output channels so they can be
+// consumed concurrently. Each value is delivered to exactly one of the
+// returned channels. All outputs are closed once in is drained or ctx is
+// canceled. n < 1 is clamped to 1.
+func FanOut[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	if n < 1 {
+		n = 1
+	}
+
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		i := 0
+		for v := range OrDone(ctx, in) {
+			select {
+			case outs[i%n] <- v:
+			case <-ctx.Done():
+				return
+			}
+			i++
+		}
+	}()
+
+	return result
+}
+
+// FanIn merges multiple channels into one. The returned channel is closed
+// once every input channel is drained or ctx is canceled.
+func FanIn[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	var wg sync.WaitGroup
+	wg.Add(len(channels))
+	for _, c := range channels {
+		go func(c <-chan T) {
+			defer wg.Done()
+			for v := range OrDone(ctx, c) {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// Map applies f to every value received from in using workers concurrent
+// goroutines and sends the results on the returned channel. The first error
+// returned by f is sent on the returned error channel and cancels the
+// remaining workers; if in drains without error, nil is sent instead. Either
+// way exactly one value is sent on the error channel, so callers can simply
+// receive once after ranging over the result channel.
+func Map[T, U any](ctx context.Context, in <-chan T, f func(context.Context, T) (U, error), workers int) (<-chan U, <-chan error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	out := make(chan U)
+	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for v := range OrDone(ctx, in) {
+				u, err := f(ctx, v)
+				if err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+				select {
+				case out <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		select {
+		case errCh <- nil:
+		default:
+		}
+		cancel()
+		close(out)
+	}()
+
+	return out, errCh
+}
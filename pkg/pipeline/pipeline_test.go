@@ -0,0 +1,178 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tkdn/go-sandbox/pkg/pipeline"
+)
+
+func TestGenerator(t *testing.T) {
+	ctx := context.Background()
+	var got []int
+	for v := range pipeline.Generator(ctx, 1, 2, 3) {
+		got = append(got, v)
+	}
+	want := []int{1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGeneratorStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	values := make([]int, 1000)
+	out := pipeline.Generator(ctx, values...)
+
+	<-out
+	cancel()
+
+	// The generator must stop sending once ctx is canceled, so the channel
+	// closes long before the remaining values are all delivered. A generator
+	// that ignored ctx would hand every one of them to the reader below.
+	received := 0
+	done := make(chan struct{})
+	go func() {
+		for range out {
+			received++
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("generator goroutine leaked past context cancellation")
+	}
+	if received >= len(values)-1 {
+		t.Fatalf("received all %d remaining values after cancel, want the generator to stop early", received)
+	}
+}
+
+func TestOrDoneStopsWhenInputNeverSends(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	blocked := make(chan int) // never sent on; a plain receive would block forever
+	out := pipeline.OrDone(ctx, blocked)
+
+	cancel()
+
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("expected no value after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OrDone did not unblock after context cancellation")
+	}
+}
+
+func TestFanOutFanIn(t *testing.T) {
+	ctx := context.Background()
+	in := pipeline.Generator(ctx, 1, 2, 3, 4, 5, 6)
+	outs := pipeline.FanOut(ctx, in, 3)
+	merged := pipeline.FanIn(ctx, outs...)
+
+	var got []int
+	for v := range merged {
+		got = append(got, v)
+	}
+	sort.Ints(got)
+
+	want := []int{1, 2, 3, 4, 5, 6}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFanOutClampsNonPositiveWorkers(t *testing.T) {
+	ctx := context.Background()
+	in := pipeline.Generator(ctx, 1, 2, 3)
+	outs := pipeline.FanOut(ctx, in, 0)
+
+	if len(outs) != 1 {
+		t.Fatalf("got %d output channels, want 1", len(outs))
+	}
+
+	merged := pipeline.FanIn(ctx, outs...)
+	var got []int
+	for v := range merged {
+		got = append(got, v)
+	}
+	sort.Ints(got)
+
+	want := []int{1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMapSuccess(t *testing.T) {
+	ctx := context.Background()
+	in := pipeline.Generator(ctx, 1, 2, 3)
+	double := func(_ context.Context, v int) (int, error) { return v * 2, nil }
+
+	out, errs := pipeline.Map(ctx, in, double, 2)
+
+	var got []int
+	for v := range out {
+		got = append(got, v)
+	}
+	sort.Ints(got)
+
+	want := []int{2, 4, 6}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMapPropagatesFirstError(t *testing.T) {
+	// A shared, cancelable context lets the caller stop the upstream
+	// Generator once Map reports an error, the same way the rewritten
+	// cmd/chan-close example does.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := pipeline.Generator(ctx, 1, 2, 3, 4, 5)
+	wantErr := errors.New("boom")
+	failOnThree := func(_ context.Context, v int) (int, error) {
+		if v == 3 {
+			return 0, wantErr
+		}
+		return v, nil
+	}
+
+	out, errs := pipeline.Map(ctx, in, failOnThree, 1)
+
+	for range out {
+	}
+	err := <-errs
+	cancel()
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("got error %v, want %v", err, wantErr)
+	}
+}